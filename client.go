@@ -0,0 +1,196 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenFile is the name of the file used to cache the OAuth2 bearer token.
+const tokenFile = "token.json"
+
+// token is a struct that defines the cached OAuth2 bearer token.
+type token struct {
+	AccessToken string    `json:"access_token"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// client is a struct that wraps an authenticated HTTP connection to
+// Reddit's OAuth2 API. A single client is reused across subreddits so that
+// the bearer token only has to be obtained once per run.
+type client struct {
+	http    *http.Client
+	tokenMu sync.Mutex
+	token   token
+	limiter rateLimiter
+}
+
+// newClient returns a client ready to authenticate against Reddit's OAuth2
+// API.
+func newClient() *client {
+	return &client{
+		http: &http.Client{
+			Timeout: 20 * time.Second,
+		},
+	}
+}
+
+// userAgent returns the program identifying User-Agent string used to
+// fulfill API rules.
+func userAgent() string {
+	return fmt.Sprintf("unix:%s:v%s (by /u/ggustafsson)", appName, appVersion)
+}
+
+// authenticate obtains a bearer token via the "script" app OAuth2 flow,
+// using the password grant if Password is set, otherwise falling back to
+// the client_credentials grant. The resulting token is cached on disk and
+// reused until it expires. force skips the on-disk cache, guaranteeing a
+// fresh token even if the cache is the one that was just rejected.
+func (c *client) authenticate(force bool) (err error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	if !force {
+		if err = c.loadToken(); err == nil && time.Now().Before(c.token.Expiry) {
+			return nil
+		}
+	}
+
+	form := url.Values{}
+	if config.Password != "" {
+		form.Set("grant_type", "password")
+		form.Set("username", config.Username)
+		form.Set("password", config.Password)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+
+	req, err := http.NewRequest("POST", "https://www.reddit.com/api/v1/access_token",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(config.ClientID, config.ClientSecret)
+	req.Header.Add("User-Agent", userAgent())
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	c.token = token{
+		AccessToken: body.AccessToken,
+		// Refresh a minute early to avoid racing against actual expiry.
+		Expiry: time.Now().Add(time.Duration(body.ExpiresIn-60) * time.Second),
+	}
+	return c.saveToken()
+}
+
+// loadToken reads the cached bearer token from ProgramPath, if it exists.
+func (c *client) loadToken() (err error) {
+	path := fmt.Sprintf("%s/%s", config.ProgramPath, tokenFile)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewDecoder(file).Decode(&c.token)
+}
+
+// saveToken writes the current bearer token to ProgramPath so that it can
+// be reused by later runs instead of reauthenticating every time. The file
+// is created 0600 since it carries a live bearer token.
+func (c *client) saveToken() (err error) {
+	path := fmt.Sprintf("%s/%s", config.ProgramPath, tokenFile)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(c.token)
+}
+
+// subredditPath returns the oauth.reddit.com listing path for name,
+// handling the special pseudo-feeds "home" and multireddit paths of the
+// form "u/<user>/m/<name>" in addition to regular subreddits. "all" is just
+// a regular subreddit name as far as Reddit's API is concerned.
+func subredditPath(name string) string {
+	switch {
+	case name == "home":
+		return "/.json"
+	case strings.HasPrefix(name, "u/") && strings.Contains(name, "/m/"):
+		return fmt.Sprintf("/%s.json", name)
+	default:
+		return fmt.Sprintf("/r/%s.json", name)
+	}
+}
+
+// checkSub checks specific Subreddit for new posts, authenticating and
+// refreshing the bearer token on expiry or revocation. Returns list of
+// posts.
+func (c *client) checkSub(name string) (posts []Post, err error) {
+	if err = c.authenticate(false); err != nil {
+		return nil, err
+	}
+	posts, status, err := c.fetchSub(name)
+	if status == http.StatusUnauthorized {
+		if err = c.authenticate(true); err != nil {
+			return nil, err
+		}
+		posts, _, err = c.fetchSub(name)
+	}
+	return posts, err
+}
+
+// fetchSub performs a single authenticated request for name and returns the
+// parsed posts along with the raw HTTP status code so checkSub can decide
+// whether to retry after a token refresh.
+func (c *client) fetchSub(name string) (posts []Post, status int, err error) {
+	reqURL := "https://oauth.reddit.com" + subredditPath(name)
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.tokenMu.Lock()
+	accessToken := c.token.AccessToken
+	c.tokenMu.Unlock()
+	req.Header.Add("User-Agent", userAgent())
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	c.limiter.wait()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	c.limiter.update(resp.Header)
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, errors.New(resp.Status)
+	}
+	sub := new(response)
+	if err = json.NewDecoder(resp.Body).Decode(&sub); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return postsFromResponse(sub), resp.StatusCode, nil
+}
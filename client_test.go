@@ -0,0 +1,23 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import "testing"
+
+func TestSubredditPath(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"golang", "/r/golang.json"},
+		{"home", "/.json"},
+		{"u/someone/m/mymulti", "/u/someone/m/mymulti.json"},
+		{"all", "/r/all.json"},
+	}
+	for _, c := range cases {
+		if got := subredditPath(c.name); got != c.want {
+			t.Errorf("subredditPath(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultPollInterval is used for subreddits without their own or a global
+// PollInterval configured.
+const defaultPollInterval = 5 * time.Minute
+
+// runDaemon keeps sredd running, polling every subreddit on its own
+// interval until SIGINT/SIGTERM, and reloads config.json on SIGHUP. Unlike
+// the one-shot mode, new posts are dispatched asynchronously and there is
+// no "Press Return" gate between subreddits.
+func runDaemon() error {
+	if err := validateRunConfig(); err != nil {
+		return fmt.Errorf("Config error: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	c := newClient()
+	// seenURLs catches crossposts across subreddits for as long as the
+	// daemon runs, the same way seenURLs does in one-shot mode per run.
+	seenURLs := &sync.Map{}
+
+	var wg sync.WaitGroup
+	pollers := make(map[string]context.CancelFunc)
+
+	start := func(name string) {
+		pollCtx, cancel := context.WithCancel(ctx)
+		pollers[name] = cancel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pollSubreddit(pollCtx, c, name, seenURLs, &wg)
+		}()
+	}
+	for _, name := range config.Subreddits {
+		start(name)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-hup:
+			fmt.Println("Received SIGHUP, reloading config...")
+			// Stop every poller and wait for its goroutine to actually
+			// return before touching config/postFilter, since
+			// pollSubreddit reads both without synchronization of its
+			// own; reloading while one is still in flight would race.
+			for name, cancel := range pollers {
+				cancel()
+				delete(pollers, name)
+			}
+			wg.Wait()
+			if err := readConfig(); err != nil {
+				fmt.Fprintf(os.Stderr, "Config reload error: %v\n", err)
+			}
+			// Restart pollers from whatever config.Subreddits currently
+			// holds even on a failed reload, rather than leaving the
+			// daemon idle.
+			for _, name := range config.Subreddits {
+				start(name)
+			}
+		}
+	}
+}
+
+// pollSubreddit checks name on its own interval, plus jitter, until ctx is
+// canceled. New posts are passed through the filter DSL and dispatched
+// through the handler pipeline in the background; wg tracks that detached
+// dispatch so that runDaemon's SIGHUP/shutdown wg.Wait() also waits for it,
+// since dispatch reads the global config concurrently with readConfig's
+// writes otherwise.
+func pollSubreddit(ctx context.Context, c *client, name string, seenURLs *sync.Map, wg *sync.WaitGroup) {
+	for {
+		wait := pollInterval(name)
+		if jitterMax := int64(wait) / 4; jitterMax > 0 {
+			wait += time.Duration(rand.Int63n(jitterMax))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		posts, err := c.checkSub(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Subreddit error (%s): %v\n", name, err)
+			continue
+		}
+		newPosts, err := checkNew(name, posts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "New posts error (%s): %v\n", name, err)
+			continue
+		}
+
+		var dispatchable []Post
+		for _, post := range newPosts {
+			if !postFilter.allows(post) {
+				continue
+			}
+			if _, dup := seenURLs.LoadOrStore(post.URL, true); dup {
+				continue
+			}
+			dispatchable = append(dispatchable, post)
+		}
+		if len(dispatchable) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(posts []Post) {
+			defer wg.Done()
+			if err := dispatch(ctx, posts); err != nil {
+				fmt.Fprintf(os.Stderr, "Handler error (%s): %v\n", name, err)
+			}
+		}(dispatchable)
+	}
+}
+
+// pollInterval returns the configured poll interval for name, falling
+// back to the global PollInterval and then defaultPollInterval.
+func pollInterval(name string) time.Duration {
+	if raw, ok := config.SubredditPollIntervals[name]; ok {
+		if d, err := time.ParseDuration(raw); err == nil {
+			return d
+		}
+	}
+	if config.PollInterval != "" {
+		if d, err := time.ParseDuration(config.PollInterval); err == nil {
+			return d
+		}
+	}
+	return defaultPollInterval
+}
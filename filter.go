@@ -0,0 +1,117 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"regexp"
+	"time"
+)
+
+// FilterConfig is the user-facing filter DSL, read straight from
+// config.json. TitleInclude/TitleExclude are regular expressions and
+// MaxAge is a duration string, e.g. "24h".
+type FilterConfig struct {
+	MinScore    int
+	MinComments int
+	// AllowNSFW is a *bool, not bool, so that an omitted Filter block (the
+	// common case before this DSL existed) defaults to "allow", matching
+	// sredd's original behavior, rather than silently dropping every
+	// over_18 post because the zero value of bool is false.
+	AllowNSFW    *bool
+	FlairAllow   []string
+	FlairDeny    []string
+	AuthorDeny   []string
+	TitleInclude string
+	TitleExclude string
+	MaxAge       string
+}
+
+// filter is the compiled form of a FilterConfig, ready to be applied to
+// posts without re-parsing regular expressions or durations each time.
+type filter struct {
+	minScore     int
+	minComments  int
+	allowNSFW    bool
+	flairAllow   map[string]bool
+	flairDeny    map[string]bool
+	authorDeny   map[string]bool
+	titleInclude *regexp.Regexp
+	titleExclude *regexp.Regexp
+	maxAge       time.Duration
+}
+
+// newFilter compiles cfg into a filter, or returns an error if a regular
+// expression or duration in cfg is malformed.
+func newFilter(cfg FilterConfig) (f *filter, err error) {
+	f = &filter{
+		minScore:    cfg.MinScore,
+		minComments: cfg.MinComments,
+		allowNSFW:   cfg.AllowNSFW == nil || *cfg.AllowNSFW,
+		flairAllow:  toSet(cfg.FlairAllow),
+		flairDeny:   toSet(cfg.FlairDeny),
+		authorDeny:  toSet(cfg.AuthorDeny),
+	}
+	if cfg.TitleInclude != "" {
+		if f.titleInclude, err = regexp.Compile(cfg.TitleInclude); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TitleExclude != "" {
+		if f.titleExclude, err = regexp.Compile(cfg.TitleExclude); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxAge != "" {
+		if f.maxAge, err = time.ParseDuration(cfg.MaxAge); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// toSet turns values into a lookup set. Returns nil, not an empty map, for
+// an empty/nil input so that allow-list checks can tell "no rule" apart
+// from "rule that matches nothing".
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// allows reports whether post passes every configured rule.
+func (f *filter) allows(post Post) bool {
+	if post.Score < f.minScore {
+		return false
+	}
+	if post.NumComments < f.minComments {
+		return false
+	}
+	if post.Over18 && !f.allowNSFW {
+		return false
+	}
+	if f.flairAllow != nil && !f.flairAllow[post.LinkFlairText] {
+		return false
+	}
+	if f.flairDeny != nil && f.flairDeny[post.LinkFlairText] {
+		return false
+	}
+	if f.authorDeny != nil && f.authorDeny[post.Author] {
+		return false
+	}
+	if f.titleInclude != nil && !f.titleInclude.MatchString(post.Title) {
+		return false
+	}
+	if f.titleExclude != nil && f.titleExclude.MatchString(post.Title) {
+		return false
+	}
+	if f.maxAge > 0 && time.Since(post.CreatedUTC) > f.maxAge {
+		return false
+	}
+	return true
+}
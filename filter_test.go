@@ -0,0 +1,91 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import "testing"
+
+func TestFilterAllowsDefaultsToAllowingNSFW(t *testing.T) {
+	f, err := newFilter(FilterConfig{})
+	if err != nil {
+		t.Fatalf("newFilter: %v", err)
+	}
+	if !f.allows(Post{Over18: true}) {
+		t.Error("allows() rejected an over_18 post with no Filter block configured")
+	}
+}
+
+func TestFilterAllowsNSFWExplicitFalse(t *testing.T) {
+	allow := false
+	f, err := newFilter(FilterConfig{AllowNSFW: &allow})
+	if err != nil {
+		t.Fatalf("newFilter: %v", err)
+	}
+	if f.allows(Post{Over18: true}) {
+		t.Error("allows() let through an over_18 post with AllowNSFW explicitly false")
+	}
+	if !f.allows(Post{Over18: false}) {
+		t.Error("allows() rejected a non-NSFW post with AllowNSFW explicitly false")
+	}
+}
+
+func TestFilterAllowsMinScoreAndComments(t *testing.T) {
+	f, err := newFilter(FilterConfig{MinScore: 10, MinComments: 5})
+	if err != nil {
+		t.Fatalf("newFilter: %v", err)
+	}
+	if f.allows(Post{Score: 9, NumComments: 5}) {
+		t.Error("allows() let through a post below MinScore")
+	}
+	if f.allows(Post{Score: 10, NumComments: 4}) {
+		t.Error("allows() let through a post below MinComments")
+	}
+	if !f.allows(Post{Score: 10, NumComments: 5}) {
+		t.Error("allows() rejected a post meeting both thresholds")
+	}
+}
+
+func TestFilterAllowsFlairAndAuthor(t *testing.T) {
+	f, err := newFilter(FilterConfig{
+		FlairAllow: []string{"News"},
+		FlairDeny:  []string{"Meme"},
+		AuthorDeny: []string{"spammer"},
+	})
+	if err != nil {
+		t.Fatalf("newFilter: %v", err)
+	}
+	if f.allows(Post{LinkFlairText: "Discussion"}) {
+		t.Error("allows() let through a flair not in FlairAllow")
+	}
+	if f.allows(Post{LinkFlairText: "Meme"}) {
+		t.Error("allows() let through a flair in FlairDeny")
+	}
+	if f.allows(Post{LinkFlairText: "News", Author: "spammer"}) {
+		t.Error("allows() let through an author in AuthorDeny")
+	}
+	if !f.allows(Post{LinkFlairText: "News", Author: "someone"}) {
+		t.Error("allows() rejected a post passing every flair/author rule")
+	}
+}
+
+func TestFilterAllowsTitleIncludeExclude(t *testing.T) {
+	f, err := newFilter(FilterConfig{TitleInclude: "(?i)release", TitleExclude: "beta"})
+	if err != nil {
+		t.Fatalf("newFilter: %v", err)
+	}
+	if f.allows(Post{Title: "Nothing interesting"}) {
+		t.Error("allows() let through a title not matching TitleInclude")
+	}
+	if f.allows(Post{Title: "New Release (beta)"}) {
+		t.Error("allows() let through a title matching TitleExclude")
+	}
+	if !f.allows(Post{Title: "New Release"}) {
+		t.Error("allows() rejected a title matching TitleInclude and not TitleExclude")
+	}
+}
+
+func TestNewFilterBadRegexp(t *testing.T) {
+	if _, err := newFilter(FilterConfig{TitleInclude: "("}); err == nil {
+		t.Error("newFilter did not error on a malformed TitleInclude regexp")
+	}
+}
@@ -0,0 +1,267 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// maxFeedEntries is the number of items kept in the "rss" handler's feed
+// file before the oldest ones are dropped.
+const maxFeedEntries = 100
+
+// HandlerConfig is a struct that defines one configured output handler.
+// Which fields apply depends on Type; unused fields are ignored.
+type HandlerConfig struct {
+	Type        string
+	Command     string
+	CommandArgs []string
+	WebhookURL  string
+	Path        string
+}
+
+// Handler is implemented by every output mechanism sredd can dispatch new
+// posts through.
+type Handler interface {
+	Handle(ctx context.Context, posts []Post) error
+}
+
+// newHandler builds the Handler described by cfg.
+func newHandler(cfg HandlerConfig) (Handler, error) {
+	switch cfg.Type {
+	case "exec", "":
+		return &execHandler{command: cfg.Command, args: cfg.CommandArgs}, nil
+	case "open":
+		return &openHandler{}, nil
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, errors.New("handler 'webhook' requires 'WebhookURL'")
+		}
+		return &webhookHandler{
+			url:  cfg.WebhookURL,
+			http: &http.Client{Timeout: 20 * time.Second},
+		}, nil
+	case "rss":
+		path := cfg.Path
+		if path == "" {
+			path = filepath.Join(config.ProgramPath, "feed.xml")
+		}
+		return &rssHandler{path: path}, nil
+	case "maildir":
+		path := cfg.Path
+		if path == "" {
+			path = filepath.Join(config.ProgramPath, "maildir")
+		}
+		return &maildirHandler{path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown handler type %q", cfg.Type)
+	}
+}
+
+// dispatch prints out list of URL's and runs posts through every
+// configured handler. If Handlers is unset in config.json, it falls back
+// to a single "exec" handler built from Command/CommandArgs, matching
+// sredd's original behavior. If noExec (the global "--no-exec" flag) is
+// set, it only prints and skips running any handler.
+func dispatch(ctx context.Context, posts []Post) (err error) {
+	for _, post := range posts {
+		fmt.Printf("URL: %s\n", post.URL)
+	}
+	if noExec {
+		return nil
+	}
+	configs := config.Handlers
+	if len(configs) == 0 {
+		configs = []HandlerConfig{
+			{Type: "exec", Command: config.Command, CommandArgs: config.CommandArgs},
+		}
+	}
+	for _, cfg := range configs {
+		handler, err := newHandler(cfg)
+		if err != nil {
+			return err
+		}
+		if err = handler.Handle(ctx, posts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// urls returns the URL of every post.
+func urlsOf(posts []Post) (urls []string) {
+	for _, post := range posts {
+		urls = append(urls, post.URL)
+	}
+	return urls
+}
+
+// execHandler runs Command with CommandArgs followed by the posts' URL's,
+// e.g. "open -a Safari <URL1> ...". This is sredd's original behavior.
+type execHandler struct {
+	command string
+	args    []string
+}
+
+func (h *execHandler) Handle(ctx context.Context, posts []Post) (err error) {
+	args := append(h.args, urlsOf(posts)...)
+	return exec.CommandContext(ctx, h.command, args...).Run()
+}
+
+// openHandler opens each post's URL with the platform's default handler,
+// so that users don't need to configure Command at all.
+type openHandler struct{}
+
+func (h *openHandler) Handle(ctx context.Context, posts []Post) error {
+	for _, post := range posts {
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.CommandContext(ctx, "open", post.URL)
+		case "windows":
+			cmd = exec.CommandContext(ctx, "cmd", "/c", "start", post.URL)
+		default:
+			cmd = exec.CommandContext(ctx, "xdg-open", post.URL)
+		}
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookHandler POSTs a JSON payload of the new posts to a user-supplied
+// URL, e.g. for Discord/Slack/Matrix bridges.
+type webhookHandler struct {
+	url  string
+	http *http.Client
+}
+
+func (h *webhookHandler) Handle(ctx context.Context, posts []Post) (err error) {
+	body, err := json.Marshal(struct {
+		Posts []Post `json:"posts"`
+	}{Posts: posts})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// atomFeed and atomEntry are the minimal subset of the Atom format needed
+// to read back and extend the feed file written by rssHandler.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+// rssFileMu serializes the read-modify-write in rssHandler.Handle. A new
+// rssHandler is built for every dispatch (see newHandler), so the lock has
+// to live at package scope rather than on the struct; without it, two
+// dispatches racing on the same feed file could clobber each other's
+// entries.
+var rssFileMu sync.Mutex
+
+// rssHandler writes new posts into an Atom feed file so that sredd can be
+// read back through any feed reader instead of only a browser.
+type rssHandler struct {
+	path string
+}
+
+func (h *rssHandler) Handle(ctx context.Context, posts []Post) (err error) {
+	rssFileMu.Lock()
+	defer rssFileMu.Unlock()
+
+	feed := atomFeed{
+		XMLNS: "http://www.w3.org/2005/Atom",
+		Title: fmt.Sprintf("%s new posts", appName),
+		ID:    "urn:" + appName + ":feed",
+	}
+	if existing, err := os.ReadFile(h.path); err == nil {
+		xml.Unmarshal(existing, &feed)
+	}
+	now := time.Now().Format(time.RFC3339)
+	for _, post := range posts {
+		feed.Entries = append([]atomEntry{{
+			Title:   post.URL,
+			ID:      post.URL,
+			Link:    atomLink{Href: post.URL},
+			Updated: now,
+		}}, feed.Entries...)
+	}
+	if len(feed.Entries) > maxFeedEntries {
+		feed.Entries = feed.Entries[:maxFeedEntries]
+	}
+	feed.Updated = now
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append([]byte(xml.Header), out...)
+	return os.WriteFile(h.path, out, 0644)
+}
+
+// maildirHandler drops one message per new post into a Maildir under
+// path, so that mail clients can be pointed at sredd's output directly.
+type maildirHandler struct {
+	path string
+}
+
+func (h *maildirHandler) Handle(ctx context.Context, posts []Post) (err error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err = os.MkdirAll(filepath.Join(h.path, sub), 0755); err != nil {
+			return err
+		}
+	}
+	for i, post := range posts {
+		name := fmt.Sprintf("%d.%d.%s", time.Now().UnixNano(), i, appName)
+		msg := fmt.Sprintf("From: %s\r\nSubject: New post on r/%s: %s\r\nDate: %s\r\n\r\n%s\r\n",
+			appName, post.Subreddit, post.Title, time.Now().Format(time.RFC1123Z), post.URL)
+		path := filepath.Join(h.path, "new", name)
+		if err = os.WriteFile(path, []byte(msg), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
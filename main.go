@@ -6,18 +6,17 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
-	"os/exec"
 	"os/user"
-	"regexp"
-	"strings"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/urfave/cli/v2"
 	"golang.org/x/term"
 )
 
@@ -30,136 +29,79 @@ const (
 // config is a global variable containing current user and runtime settings.
 var config options
 
+// postFilter is the compiled form of config.Filter, built once in
+// readConfig so that malformed regular expressions are caught at startup.
+var postFilter *filter
+
+// configFileOverride is set from the global "--config" flag and, when
+// non-empty, replaces the default "~/.sredd/config.json" path.
+var configFileOverride string
+
+// noExec, set from the global "--no-exec" flag, makes dispatch print posts
+// without running any configured Handler.
+var noExec bool
+
+// jsonOutput, set from the global "--json" flag, switches "list" and
+// "check" to machine-readable JSON output.
+var jsonOutput bool
+
 // options is a struct that defines all configuration values.
 type options struct {
+	ClientID       string
+	ClientSecret   string
 	Command        string
 	CommandArgs    []string
+	Concurrency    int
+	Filter         FilterConfig
 	FilterComments bool
+	Handlers       []HandlerConfig
+	Mode           string
+	Password       string
+	PollInterval   string
 	ProgramPath    string
-	Subreddits     []string
+	// SubredditPollIntervals overrides PollInterval for specific
+	// subreddits in daemon mode, e.g. {"golang": "2m"}.
+	SubredditPollIntervals map[string]string
+	Subreddits             []string
+	Username               string
 }
 
-// response is a struct that defines the expected JSON response from Reddit.
-type response struct {
-	Data struct {
-		Children []struct {
-			Data struct {
-				URL string
-			}
-		}
-	}
-}
+// defaultConcurrency is the number of subreddits fetched in parallel when
+// Concurrency is left unset in config.json.
+const defaultConcurrency = 4
 
-// checkNew runs logRead and logWrite, and then compares new and old URL lists.
-// Returns list of all new URL's.
-func checkNew(name string, urls []string) (newURLs []string, err error) {
+// checkNew runs logRead and logWrite, and then compares new and old posts
+// by fullname (Reddit's "t3_xxx" id), rather than by URL, so that Reddit
+// rewriting a URL in place doesn't cause a false "new" hit. Returns list
+// of all new posts.
+func checkNew(name string, posts []Post) (newPosts []Post, err error) {
 	log := fmt.Sprintf("%s/r_%s.log", config.ProgramPath, name)
 	// Read log file from last run if it exists.
-	oldURLs, err := logRead(log)
-	if err != nil {
-		return nil, err
-	}
-	// Write log file with the latest URL's.
-	err = logWrite(log, urls)
-	if err != nil {
-		return nil, err
-	}
-	// Compare list of new and old URL's.
-	var dup int
-	for _, url := range urls {
-		dup = 0
-		for _, oldURL := range oldURLs {
-			if url == oldURL {
-				dup = 1
-			}
-		}
-		if dup == 0 {
-			newURLs = append(newURLs, url)
-		}
-	}
-	return newURLs, nil
-}
-
-// checkSub checks specific Subreddit for new posts. Returns list of URL's.
-func checkSub(name string) (urls []string, err error) {
-	url := fmt.Sprintf("https://www.reddit.com/r/%s.json", name)
-	client := &http.Client{
-		Timeout: 20 * time.Second,
-	}
-	// Limit number of redirects and keep HTTP header at redirect (User-Agent).
-	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		// Check number of redirects.
-		if len(via) == 0 {
-			return nil
-		}
-		// Return error after three redirects.
-		if len(via) > 3 {
-			return fmt.Errorf("%d consecutive redirects", len(via))
-		}
-		// Duplicate HTTP header fields..
-		for key, val := range via[0].Header {
-			req.Header[key] = val
-		}
-		return nil
-	}
-	req, err := http.NewRequest("GET", url, nil)
+	oldPosts, err := logRead(log)
 	if err != nil {
 		return nil, err
 	}
-	// Program identifying user-agent string is used to fulfill API rules.
-	agent := fmt.Sprintf("unix:%s:v%s (by /u/ggustafsson)", appName, appVersion)
-	req.Header.Add("User-Agent", agent)
-	resp, err := client.Do(req)
+	// Write log file with the latest posts.
+	err = logWrite(log, posts)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(resp.Status)
+	// Compare list of new and old posts.
+	oldFullnames := make(map[string]bool, len(oldPosts))
+	for _, old := range oldPosts {
+		oldFullnames[old.Fullname] = true
 	}
-	sub := new(response)
-	err = json.NewDecoder(resp.Body).Decode(&sub)
-	if err != nil {
-		return nil, err
-	}
-	// Loop over all Subreddits posts.
-	for _, item := range sub.Data.Children {
-		itemURL := item.Data.URL
-		// Filter discussion threads if FilterComments is disabled in config.
-		if config.FilterComments && strings.Contains(itemURL, "/comments/") {
-			continue
+	for _, post := range posts {
+		if !oldFullnames[post.Fullname] {
+			newPosts = append(newPosts, post)
 		}
-		// Make sure items always starts with either http:// or https://.
-		match, _ := regexp.MatchString("^https?://", itemURL)
-		if !match {
-			continue
-		}
-		// Reddit fucks up URL's in JSON response. Replace "&amp" with "&".
-		// https://i.reddituploads.com never works without this :(
-		itemURL = strings.Replace(itemURL, "&amp;", "&", -1)
-		urls = append(urls, itemURL)
 	}
-	return urls, nil
+	return newPosts, nil
 }
 
-// execCommand prints out list of URL's and executes user specified command.
-func execCommand(urls []string) (err error) {
-	for _, url := range urls {
-		fmt.Printf("URL: %s\n", url)
-	}
-	// cmd contains the main command, e.g. "open".
-	cmd := config.Command
-	// args contains all arguments used with cmd, e.g. "-a Safari <URL1> ...".
-	args := append(config.CommandArgs, urls...)
-	err = exec.Command(cmd, args...).Run()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// logRead reads log file, if it exists, and returns all URL's.
-func logRead(log string) (oldURLs []string, err error) {
+// logRead reads log file, if it exists, and returns all posts. The log is
+// JSONL, one post per line.
+func logRead(log string) (posts []Post, err error) {
 	if _, err = os.Stat(log); err == nil {
 		file, err := os.Open(log)
 		if err != nil {
@@ -168,45 +110,74 @@ func logRead(log string) (oldURLs []string, err error) {
 		defer file.Close()
 		scanner := bufio.NewScanner(file)
 		for scanner.Scan() {
-			oldURLs = append(oldURLs, scanner.Text())
+			var post Post
+			if err = json.Unmarshal(scanner.Bytes(), &post); err != nil {
+				return nil, err
+			}
+			posts = append(posts, post)
 		}
 		if err = scanner.Err(); err != nil {
 			return nil, err
 		}
 	}
-	return oldURLs, nil
+	return posts, nil
 }
 
-// logWrite writes down all new URL's to log file.
-func logWrite(log string, urls []string) (err error) {
-	file, err := os.Create(log)
+// logWrite writes down all posts to log file, one JSON object per line.
+// The file is written to a ".tmp" sibling and renamed into place so that a
+// kill mid-write cannot corrupt the log.
+func logWrite(log string, posts []Post) (err error) {
+	tmp := log + ".tmp"
+	file, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 	writer := bufio.NewWriter(file)
-	for _, url := range urls {
-		_, err = writer.WriteString(fmt.Sprintf("%s\n", url))
+	for _, post := range posts {
+		data, err := json.Marshal(post)
 		if err != nil {
+			file.Close()
+			return err
+		}
+		if _, err = writer.Write(append(data, '\n')); err != nil {
+			file.Close()
 			return err
 		}
 	}
-	err = writer.Flush()
-	if err != nil {
+	if err = writer.Flush(); err != nil {
+		file.Close()
 		return err
 	}
-	return nil
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, log)
 }
 
-// readConfig reads JSON config file and set values in struct variable config.
-func readConfig() (err error) {
+// configPath returns the location of config.json, honoring the global
+// "--config" flag (configFileOverride) and otherwise defaulting to
+// "~/.sredd/config.json".
+func configPath() string {
+	if configFileOverride != "" {
+		return configFileOverride
+	}
 	usr, err := user.Current()
 	if err != nil {
-		return err
+		return fmt.Sprintf(".%s/config.json", appName)
 	}
-	// Location of config and log files, e.g. "~/.sredd/config.json".
-	config.ProgramPath = fmt.Sprintf("%s/.%s", usr.HomeDir, appName)
-	path := fmt.Sprintf("%s/config.json", config.ProgramPath)
+	return fmt.Sprintf("%s/.%s/config.json", usr.HomeDir, appName)
+}
+
+// readConfig reads JSON config file and set values in struct variable
+// config. It only validates what every command needs (a parseable Filter
+// block); "add"/"remove"/"list" work against a freshly created config with
+// no Subreddits/ClientID/ClientSecret/Command yet, so those are validated
+// separately by validateCredentials/validateRunConfig where actually
+// required.
+func readConfig() (err error) {
+	path := configPath()
+	// Location of config and log files, e.g. "~/.sredd".
+	config.ProgramPath = filepath.Dir(path)
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -215,97 +186,94 @@ func readConfig() (err error) {
 	if err != nil {
 		return err
 	}
-	if config.Command == "" {
-		return errors.New("option 'Command' not set")
+	if config.Concurrency == 0 {
+		config.Concurrency = defaultConcurrency
 	}
-	if len(config.Subreddits) == 0 {
-		return errors.New("option 'Subreddits' not set")
+	postFilter, err = newFilter(config.Filter)
+	if err != nil {
+		return fmt.Errorf("option 'Filter': %w", err)
 	}
 	return nil
 }
 
-// usage prints out information about how to use the program.
-func usage() {
-	info := `
-Run without arguments to check subreddit's specified in config.
-
-Options:
-    -h, --help       Display this help text
-    -v, --version    Display version information
-`
-	fmt.Printf("Usage: %s [OPTION]\n", appName)
-	fmt.Printf("%s", info)
-}
-
-// version prints out various information about the program.
-func version() {
-	info := `
-Web: https://github.com/ggustafsson/sredd
-Git: https://github.com/ggustafsson/sredd.git
-
-Written by Göran Gustafsson <gustafsson.g@gmail.com>
-Released under the BSD 3-Clause license
-`
-	fmt.Printf("%s - %s, version %s\n", appName, appLongName, appVersion)
-	fmt.Printf("%s", info)
+// validateCredentials ensures config has what's needed to authenticate
+// against Reddit's OAuth2 API, required by every command that talks to
+// Reddit but not by "add"/"remove"/"list", which only touch config.json.
+func validateCredentials() error {
+	if config.ClientID == "" {
+		return errors.New("option 'ClientID' not set")
+	}
+	if config.ClientSecret == "" {
+		return errors.New("option 'ClientSecret' not set")
+	}
+	return nil
 }
 
-func init() {
-	// Only accept one single argument, or none at all.
-	if len(os.Args[1:]) == 1 {
-		switch os.Args[1] {
-		case "-h", "--help":
-			usage()
-		case "-v", "--version":
-			version()
-		default:
-			usage()
-			os.Exit(1)
-		}
-		os.Exit(0)
-	} else if len(os.Args[1:]) >= 2 {
-		usage()
-		os.Exit(1)
+// validateRunConfig ensures config has everything "run"/"daemon" need to
+// actually check subreddits and dispatch new posts.
+func validateRunConfig() error {
+	if err := validateCredentials(); err != nil {
+		return err
 	}
-
-	// Load configuration file so program can run.
-	err := readConfig()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Config error: %v\n", err)
-		os.Exit(1)
+	// Command is only required when there are no explicit Handlers to fall
+	// back to dispatch's implicit "exec" handler.
+	if config.Command == "" && len(config.Handlers) == 0 {
+		return errors.New("option 'Command' not set (or configure 'Handlers')")
+	}
+	if len(config.Subreddits) == 0 {
+		return errors.New("option 'Subreddits' not set")
 	}
+	return nil
 }
 
-func main() {
-	for index, name := range config.Subreddits {
-		fmt.Printf("Checking r/%s for new posts...\n", name)
-		// Check subreddit and return all URL's.
-		urls, err := checkSub(name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Subreddit error: %v\n", err)
-			os.Exit(1)
+// runOnce checks every configured subreddit exactly once, prompting
+// interactively between subreddits as sredd has always done. It is the
+// Action behind both the default command and "run".
+func runOnce(ctx *cli.Context) error {
+	if err := validateRunConfig(); err != nil {
+		return cli.Exit(fmt.Sprintf("Config error: %v", err), 1)
+	}
+	c := newClient()
+	// Fetch every subreddit concurrently, but keep the results in the same
+	// order as config.Subreddits so the interactive prompts below stay
+	// deterministic.
+	results := fetchAll(c, config.Subreddits)
+	// seenURLs catches crossposts so that a URL shared between two checked
+	// subreddits only triggers the command once.
+	seenURLs := make(map[string]bool)
+	for index, result := range results {
+		fmt.Printf("Checking r/%s for new posts...\n", result.name)
+		if result.err != nil {
+			return cli.Exit(fmt.Sprintf("Subreddit error: %v", result.err), 1)
 		}
-		// Check which URL's are new compared to last run.
-		newURLs, err := checkNew(name, urls)
+		// Check which posts are new compared to last run.
+		newPosts, err := checkNew(result.name, result.posts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "New posts error: %v\n", err)
-			os.Exit(1)
+			return cli.Exit(fmt.Sprintf("New posts error: %v", err), 1)
+		}
+		var posts []Post
+		for _, post := range newPosts {
+			// Drop posts rejected by the filter DSL, then crossposts whose
+			// URL was already dispatched for another subreddit this run.
+			if !postFilter.allows(post) || seenURLs[post.URL] {
+				continue
+			}
+			seenURLs[post.URL] = true
+			posts = append(posts, post)
 		}
-		if len(newURLs) == 0 {
+		if len(posts) == 0 {
 			fmt.Println("No new posts found!")
 			// Only print newline if there are subreddits left.
-			if index != len(config.Subreddits)-1 {
+			if index != len(results)-1 {
 				fmt.Println()
 			}
 			continue
 		}
-		err = execCommand(newURLs)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Command error: %v\n", err)
-			os.Exit(1)
+		if err = dispatch(context.Background(), posts); err != nil {
+			return cli.Exit(fmt.Sprintf("Handler error: %v", err), 1)
 		}
 		// Only wait for input if there are subreddits left.
-		if index == len(config.Subreddits)-1 {
+		if index == len(results)-1 {
 			break
 		}
 		fmt.Printf("Press 'Return' key when ready to continue...")
@@ -317,4 +285,12 @@ func main() {
 		}
 		fmt.Println()
 	}
+	return nil
+}
+
+func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,58 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import "testing"
+
+func TestCheckNewDedupesByFullname(t *testing.T) {
+	config.ProgramPath = t.TempDir()
+
+	first := []Post{
+		{Fullname: "t3_1", URL: "https://example.com/1"},
+		{Fullname: "t3_2", URL: "https://example.com/2"},
+	}
+	newPosts, err := checkNew("golang", first)
+	if err != nil {
+		t.Fatalf("checkNew: %v", err)
+	}
+	if len(newPosts) != 2 {
+		t.Fatalf("first run: got %d new posts, want 2", len(newPosts))
+	}
+
+	// Second run: Reddit rewrote the URL of t3_1 in place, and t3_3 is
+	// genuinely new. Dedup must key off Fullname, not URL.
+	second := []Post{
+		{Fullname: "t3_1", URL: "https://example.com/1-rewritten"},
+		{Fullname: "t3_2", URL: "https://example.com/2"},
+		{Fullname: "t3_3", URL: "https://example.com/3"},
+	}
+	newPosts, err = checkNew("golang", second)
+	if err != nil {
+		t.Fatalf("checkNew: %v", err)
+	}
+	if len(newPosts) != 1 || newPosts[0].Fullname != "t3_3" {
+		t.Fatalf("second run: got %v, want only t3_3", newPosts)
+	}
+}
+
+func TestCheckNewEmptyLogIsNotNew(t *testing.T) {
+	config.ProgramPath = t.TempDir()
+
+	posts := []Post{{Fullname: "t3_1", URL: "https://example.com/1"}}
+	newPosts, err := checkNew("golang", posts)
+	if err != nil {
+		t.Fatalf("checkNew: %v", err)
+	}
+	if len(newPosts) != 1 {
+		t.Fatalf("got %d new posts on first run, want 1", len(newPosts))
+	}
+
+	newPosts, err = checkNew("golang", posts)
+	if err != nil {
+		t.Fatalf("checkNew: %v", err)
+	}
+	if len(newPosts) != 0 {
+		t.Fatalf("got %d new posts on repeat run with no changes, want 0", len(newPosts))
+	}
+}
@@ -0,0 +1,50 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import "sync"
+
+// subResult is the outcome of checking a single subreddit for new posts.
+type subResult struct {
+	name  string
+	posts []Post
+	err   error
+}
+
+// fetchAll checks every subreddit in names through a bounded pool of
+// Concurrency workers and returns one subResult per name, in the same
+// order as names, regardless of which worker finished it. The caller is
+// free to process results sequentially afterwards.
+func fetchAll(c *client, names []string) []subResult {
+	results := make([]subResult, len(names))
+	jobs := make(chan int)
+
+	workers := config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				posts, err := c.checkSub(names[index])
+				results[index] = subResult{name: names[index], posts: posts, err: err}
+			}
+		}()
+	}
+
+	for index := range names {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,63 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter tracks Reddit's per-client rate limit budget, derived from
+// the X-Ratelimit-Remaining and X-Ratelimit-Reset response headers, and
+// makes concurrent fetchers block once the budget for the current window
+// is exhausted.
+type rateLimiter struct {
+	mu        sync.Mutex
+	remaining float64
+	reset     time.Time
+}
+
+// wait blocks callers until the rate limiter has budget for another
+// request, or returns immediately if no limit has been observed yet. The
+// budget is reserved (decremented) under the same lock that guards the
+// check, so concurrent callers can't all observe remaining > 0 and burst
+// past the limit before update() runs.
+func (r *rateLimiter) wait() {
+	r.mu.Lock()
+	if r.reset.IsZero() || r.remaining > 0 {
+		r.remaining--
+		r.mu.Unlock()
+		return
+	}
+	reset := r.reset
+	r.mu.Unlock()
+
+	if d := time.Until(reset); d > 0 {
+		time.Sleep(d)
+	}
+
+	r.mu.Lock()
+	r.remaining--
+	r.mu.Unlock()
+}
+
+// update records the rate limit state reported by Reddit for the most
+// recently completed response. Malformed or missing headers are ignored;
+// the limiter simply keeps whatever state it already had.
+func (r *rateLimiter) update(header http.Header) {
+	remaining, err := strconv.ParseFloat(header.Get("X-Ratelimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+	seconds, err := strconv.ParseFloat(header.Get("X-Ratelimit-Reset"), 64)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.remaining = remaining
+	r.reset = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+	r.mu.Unlock()
+}
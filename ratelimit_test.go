@@ -0,0 +1,72 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitReservesBudget(t *testing.T) {
+	r := &rateLimiter{remaining: 2, reset: time.Now().Add(time.Minute)}
+	r.wait()
+	r.wait()
+	r.mu.Lock()
+	remaining := r.remaining
+	r.mu.Unlock()
+	if remaining > 0 {
+		t.Errorf("remaining = %v after exhausting budget, want <= 0", remaining)
+	}
+}
+
+func TestRateLimiterWaitConcurrentDoesNotOverspend(t *testing.T) {
+	r := &rateLimiter{remaining: 5, reset: time.Now().Add(time.Minute)}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.wait()
+		}()
+	}
+	wg.Wait()
+	r.mu.Lock()
+	remaining := r.remaining
+	r.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("remaining = %v after 5 concurrent waits against a budget of 5, want 0", remaining)
+	}
+}
+
+func TestRateLimiterWaitNoLimitObservedYet(t *testing.T) {
+	r := &rateLimiter{}
+	done := make(chan struct{})
+	go func() {
+		r.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait() blocked with no rate limit state observed yet")
+	}
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	r := &rateLimiter{}
+	header := http.Header{}
+	header.Set("X-Ratelimit-Remaining", "42")
+	header.Set("X-Ratelimit-Reset", "60")
+	r.update(header)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.remaining != 42 {
+		t.Errorf("remaining = %v, want 42", r.remaining)
+	}
+	if r.reset.Before(time.Now()) {
+		t.Error("reset was not set in the future")
+	}
+}
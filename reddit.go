@@ -0,0 +1,88 @@
+// Creator: Göran Gustafsson (gustafsson.g at gmail.com)
+// License: BSD 3-Clause
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// response is a struct that defines the expected JSON response from
+// Reddit's listing endpoints (e.g. "/r/<name>.json").
+type response struct {
+	Data struct {
+		Children []struct {
+			Data struct {
+				Name          string  `json:"name"`
+				ID            string  `json:"id"`
+				Title         string  `json:"title"`
+				Author        string  `json:"author"`
+				Subreddit     string  `json:"subreddit"`
+				Score         int     `json:"score"`
+				NumComments   int     `json:"num_comments"`
+				Over18        bool    `json:"over_18"`
+				CreatedUTC    float64 `json:"created_utc"`
+				LinkFlairText string  `json:"link_flair_text"`
+				IsSelf        bool    `json:"is_self"`
+				Permalink     string  `json:"permalink"`
+				URL           string  `json:"url"`
+			}
+		}
+	}
+}
+
+// Post is a single Reddit submission. It is what gets stored in the
+// per-subreddit log, run through the filter DSL, and handed to output
+// Handlers.
+type Post struct {
+	Fullname      string    `json:"fullname"`
+	ID            string    `json:"id"`
+	Title         string    `json:"title"`
+	Author        string    `json:"author"`
+	Subreddit     string    `json:"subreddit"`
+	Score         int       `json:"score"`
+	NumComments   int       `json:"num_comments"`
+	Over18        bool      `json:"over_18"`
+	CreatedUTC    time.Time `json:"created_utc"`
+	LinkFlairText string    `json:"link_flair_text"`
+	IsSelf        bool      `json:"is_self"`
+	Permalink     string    `json:"permalink"`
+	URL           string    `json:"url"`
+}
+
+// postsFromResponse converts a Reddit listing response into Posts.
+func postsFromResponse(sub *response) (posts []Post) {
+	for _, item := range sub.Data.Children {
+		d := item.Data
+		itemURL := d.URL
+		// Filter discussion threads if FilterComments is disabled in config.
+		if config.FilterComments && strings.Contains(itemURL, "/comments/") {
+			continue
+		}
+		// Make sure items always starts with either http:// or https://.
+		if match, _ := regexp.MatchString("^https?://", itemURL); !match {
+			continue
+		}
+		// Reddit fucks up URL's in JSON response. Replace "&amp" with "&".
+		// https://i.reddituploads.com never works without this :(
+		itemURL = strings.Replace(itemURL, "&amp;", "&", -1)
+		posts = append(posts, Post{
+			Fullname:      d.Name,
+			ID:            d.ID,
+			Title:         d.Title,
+			Author:        d.Author,
+			Subreddit:     d.Subreddit,
+			Score:         d.Score,
+			NumComments:   d.NumComments,
+			Over18:        d.Over18,
+			CreatedUTC:    time.Unix(int64(d.CreatedUTC), 0).UTC(),
+			LinkFlairText: d.LinkFlairText,
+			IsSelf:        d.IsSelf,
+			Permalink:     d.Permalink,
+			URL:           itemURL,
+		})
+	}
+	return posts
+}